@@ -0,0 +1,11 @@
+//go:build unix
+
+package stats
+
+import sysconf "github.com/tklauser/go-sysconf"
+
+func init() {
+	if ticks, err := sysconf.Sysconf(sysconf.SC_CLK_TCK); err == nil && ticks > 0 {
+		ClocksPerSec = float64(ticks)
+	}
+}
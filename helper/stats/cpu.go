@@ -4,14 +4,12 @@ import (
 	"context"
 	"fmt"
 	"math"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
 
+	"github.com/hashicorp/go-hclog"
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/shirou/gopsutil/v3/cpu"
-	"golang.org/x/sys/unix"
 )
 
 const (
@@ -19,68 +17,305 @@ const (
 	// to override the default timeout in gopsutil which has a tendency to
 	// timeout on Windows.
 	cpuInfoTimeout = 60 * time.Second
+
+	// mhzThrottleThreshold is how far, in MHz, the current frequency may drop
+	// below the max frequency before Refresh logs a warning. A gap larger
+	// than this usually means a thermal or governor throttle is in effect.
+	mhzThrottleThreshold = 100
 )
 
-var (
-	cpuMhzPerCore float64
-	cpuModelName  string
-	cpuNumCores   int
-	cpuTotalTicks float64
+// Collector gathers and caches CPU information for a single scope (normally
+// the host, but callers may construct additional Collectors to track, e.g.,
+// a specific cgroup). Init re-gathers values only once ttl has elapsed since
+// the last refresh; Refresh and StartAutoRefresh re-gather regardless of
+// ttl. A ttl of zero means the cache never expires on its own and only
+// changes when Refresh or the StartAutoRefresh goroutine runs.
+//
+// This replaces the package's original sync.Once based caching, which meant
+// values gathered at agent startup never changed even as CPU frequency
+// scaling, hotplug, or cgroup limits shifted over the life of a long-running
+// Nomad agent.
+type Collector struct {
+	mu  sync.RWMutex
+	ttl time.Duration
 
-	initErr error
-	onceLer sync.Once
-)
+	lastRefresh time.Time
+	refreshErr  error
 
-func Init() error {
-	onceLer.Do(func() {
-		var merrs *multierror.Error
-		var err error
-		if cpuNumCores, err = cpu.Counts(true); err != nil {
-			merrs = multierror.Append(merrs, fmt.Errorf("Unable to determine the number of CPU cores available: %v", err))
-		}
+	mhzCurrent     float64
+	mhzMin         float64
+	mhzPerCore     float64
+	modelName      string
+	numCores       int
+	totalTicks     float64
+	hostNumCores   int
+	hostTotalTicks float64
 
-		var cpuInfo []InfoStat
-		ctx, cancel := context.WithTimeout(context.Background(), cpuInfoTimeout)
-		defer cancel()
-		if cpuInfo, err = InfoWithContext(ctx); err != nil {
-			merrs = multierror.Append(merrs, fmt.Errorf("Unable to obtain CPU information: %v", err))
-		}
+	cancelAutoRefresh context.CancelFunc
+}
 
-		for _, cpu := range cpuInfo {
-			cpuModelName = cpu.ModelName
-			cpuMhzPerCore = cpu.Mhz
-			break
-		}
+// NewCollector creates a Collector whose cached values are reused for up to
+// ttl after each Refresh. A ttl of zero disables expiry: once populated, the
+// cache is only updated by an explicit Refresh or by StartAutoRefresh.
+func NewCollector(ttl time.Duration) *Collector {
+	return &Collector{ttl: ttl}
+}
+
+// defaultCollector backs the package-level functions below, preserving their
+// existing signatures and un-expired-by-default behavior.
+var defaultCollector = NewCollector(0)
+
+// Init gathers CPU information into the default Collector if it hasn't been
+// gathered yet or if its cache has expired. See Collector.Init.
+func Init() error {
+	return defaultCollector.Init(context.Background())
+}
 
-		// Floor all of the values such that small difference don't cause the
-		// node to fall into a unique computed node class
-		cpuMhzPerCore = math.Floor(cpuMhzPerCore)
-		cpuTotalTicks = math.Floor(float64(cpuNumCores) * cpuMhzPerCore)
+// Refresh unconditionally re-gathers CPU information into the default
+// Collector.
+func Refresh(ctx context.Context) error {
+	return defaultCollector.Refresh(ctx)
+}
+
+// StartAutoRefresh begins periodically refreshing the default Collector. See
+// Collector.StartAutoRefresh.
+func StartAutoRefresh(interval time.Duration) {
+	defaultCollector.StartAutoRefresh(interval)
+}
 
-		// Set any errors that occurred
-		initErr = merrs.ErrorOrNil()
-	})
-	return initErr
+// StopAutoRefresh halts a refresh goroutine started by StartAutoRefresh.
+func StopAutoRefresh() {
+	defaultCollector.StopAutoRefresh()
 }
 
-// CPUNumCores returns the number of CPU cores available
+// CPUNumCores returns the number of CPU cores available to Nomad, after
+// accounting for any cgroup quota or cpuset restriction.
 func CPUNumCores() int {
-	return cpuNumCores
+	return defaultCollector.CPUNumCores()
 }
 
-// CPUMHzPerCore returns the MHz per CPU core
+// CPUHostNumCores returns the number of CPU cores physically present on the
+// host, ignoring any cgroup restriction.
+func CPUHostNumCores() int {
+	return defaultCollector.CPUHostNumCores()
+}
+
+// CPUMHzPerCore returns the max MHz per CPU core, which is what should be
+// reserved against when scheduling work.
 func CPUMHzPerCore() float64 {
-	return cpuMhzPerCore
+	return defaultCollector.CPUMHzPerCore()
+}
+
+// CPUMHzCurrent returns the current MHz per CPU core
+func CPUMHzCurrent() float64 {
+	return defaultCollector.CPUMHzCurrent()
+}
+
+// CPUMHzMin returns the minimum MHz per CPU core
+func CPUMHzMin() float64 {
+	return defaultCollector.CPUMHzMin()
 }
 
 // CPUModelName returns the model name of the CPU
 func CPUModelName() string {
-	return cpuModelName
+	return defaultCollector.CPUModelName()
 }
 
-// TotalTicksAvailable calculates the total Mhz available across all cores
+// TotalTicksAvailable calculates the total Mhz available across the cores
+// Nomad may use, based on each core's maximum frequency
 func TotalTicksAvailable() float64 {
-	return cpuTotalTicks
+	return defaultCollector.TotalTicksAvailable()
+}
+
+// CPUHostTotalTicks calculates the total Mhz available across all of the
+// host's cores, ignoring any cgroup restriction.
+func CPUHostTotalTicks() float64 {
+	return defaultCollector.CPUHostTotalTicks()
+}
+
+// Init gathers CPU information if it hasn't been gathered yet or if the
+// Collector's ttl has elapsed since the last Refresh; otherwise it returns
+// the error, if any, from the last Refresh.
+func (c *Collector) Init(ctx context.Context) error {
+	c.mu.RLock()
+	fresh := !c.lastRefresh.IsZero() && (c.ttl <= 0 || time.Since(c.lastRefresh) < c.ttl)
+	err := c.refreshErr
+	c.mu.RUnlock()
+
+	if fresh {
+		return err
+	}
+	return c.Refresh(ctx)
+}
+
+// Refresh unconditionally re-gathers CPU information, regardless of ttl.
+func (c *Collector) Refresh(ctx context.Context) error {
+	var merrs *multierror.Error
+
+	hostNumCores, err := cpu.Counts(true)
+	if err != nil {
+		merrs = multierror.Append(merrs, fmt.Errorf("Unable to determine the number of CPU cores available: %v", err))
+	}
+
+	infoCtx, cancel := context.WithTimeout(ctx, cpuInfoTimeout)
+	defer cancel()
+	cpuInfo, err := InfoWithContext(infoCtx)
+	if err != nil {
+		merrs = multierror.Append(merrs, fmt.Errorf("Unable to obtain CPU information: %v", err))
+	}
+
+	var modelName string
+	var mhzPerCore, mhzCurrent, mhzMin float64
+	for _, info := range cpuInfo {
+		modelName = info.ModelName
+		mhzPerCore = info.Mhz.Max
+		mhzCurrent = info.Mhz.Current
+		mhzMin = info.Mhz.Min
+		break
+	}
+
+	// Floor all of the values such that small difference don't cause the
+	// node to fall into a unique computed node class
+	mhzPerCore = math.Floor(mhzPerCore)
+	mhzCurrent = math.Floor(mhzCurrent)
+	mhzMin = math.Floor(mhzMin)
+	hostTotalTicks := math.Floor(float64(hostNumCores) * mhzPerCore)
+
+	// Nomad may be confined to fewer cores than the host exposes, e.g. when
+	// running inside a cgroup-limited container. Scheduling should respect
+	// that budget even though the fingerprinter still wants the physical
+	// host values too.
+	numCores := effectiveCPUCount(hostNumCores)
+	totalTicks := math.Floor(effectiveCoreFraction(hostNumCores) * mhzPerCore)
+
+	if mhzCurrent > 0 && mhzPerCore-mhzCurrent > mhzThrottleThreshold {
+		hclog.L().Warn("detected CPU frequency below maximum, possible thermal or governor throttling",
+			"current_mhz", mhzCurrent, "max_mhz", mhzPerCore)
+	}
+
+	refreshErr := merrs.ErrorOrNil()
+
+	c.mu.Lock()
+	c.modelName = modelName
+	c.mhzPerCore = mhzPerCore
+	c.mhzCurrent = mhzCurrent
+	c.mhzMin = mhzMin
+	c.hostNumCores = hostNumCores
+	c.hostTotalTicks = hostTotalTicks
+	c.numCores = numCores
+	c.totalTicks = totalTicks
+	c.refreshErr = refreshErr
+	c.lastRefresh = time.Now()
+	c.mu.Unlock()
+
+	return refreshErr
+}
+
+// StartAutoRefresh begins a background goroutine that calls Refresh on the
+// given interval until StopAutoRefresh is called. It replaces any
+// auto-refresh goroutine previously started on this Collector.
+func (c *Collector) StartAutoRefresh(interval time.Duration) {
+	c.StopAutoRefresh()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.mu.Lock()
+	c.cancelAutoRefresh = cancel
+	c.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = c.Refresh(ctx)
+			}
+		}
+	}()
+}
+
+// StopAutoRefresh halts the background goroutine started by
+// StartAutoRefresh, if any.
+func (c *Collector) StopAutoRefresh() {
+	c.mu.Lock()
+	cancel := c.cancelAutoRefresh
+	c.cancelAutoRefresh = nil
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// CPUNumCores returns the number of CPU cores available to Nomad, after
+// accounting for any cgroup quota or cpuset restriction.
+func (c *Collector) CPUNumCores() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.numCores
+}
+
+// CPUHostNumCores returns the number of CPU cores physically present on the
+// host, ignoring any cgroup restriction.
+func (c *Collector) CPUHostNumCores() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.hostNumCores
+}
+
+// CPUMHzPerCore returns the max MHz per CPU core, which is what should be
+// reserved against when scheduling work.
+func (c *Collector) CPUMHzPerCore() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.mhzPerCore
+}
+
+// CPUMHzCurrent returns the current MHz per CPU core
+func (c *Collector) CPUMHzCurrent() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.mhzCurrent
+}
+
+// CPUMHzMin returns the minimum MHz per CPU core
+func (c *Collector) CPUMHzMin() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.mhzMin
+}
+
+// CPUModelName returns the model name of the CPU
+func (c *Collector) CPUModelName() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.modelName
+}
+
+// TotalTicksAvailable calculates the total Mhz available across the cores
+// Nomad may use, based on each core's maximum frequency
+func (c *Collector) TotalTicksAvailable() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.totalTicks
+}
+
+// CPUHostTotalTicks calculates the total Mhz available across all of the
+// host's cores, ignoring any cgroup restriction.
+func (c *Collector) CPUHostTotalTicks() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.hostTotalTicks
+}
+
+// MhzStat describes the current, minimum, and maximum clock frequency of a
+// CPU, in MHz.
+type MhzStat struct {
+	Current float64 `json:"current"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
 }
 
 type InfoStat struct {
@@ -93,49 +328,11 @@ type InfoStat struct {
 	CoreID     string   `json:"coreId"`
 	Cores      int32    `json:"cores"`
 	ModelName  string   `json:"modelName"`
-	Mhz        float64  `json:"mhz"`
+	Mhz        MhzStat  `json:"mhz"`
 	CacheSize  int32    `json:"cacheSize"`
 	Flags      []string `json:"flags"`
 	Microcode  string   `json:"microcode"`
 }
 
-func InfoWithContext(ctx context.Context) ([]InfoStat, error) {
-	var ret []InfoStat
-
-	c := InfoStat{}
-	c.ModelName, _ = unix.Sysctl("machdep.cpu.brand_string")
-	family, _ := unix.SysctlUint32("machdep.cpu.family")
-	c.Family = strconv.FormatUint(uint64(family), 10)
-	model, _ := unix.SysctlUint32("machdep.cpu.model")
-	c.Model = strconv.FormatUint(uint64(model), 10)
-	stepping, _ := unix.SysctlUint32("machdep.cpu.stepping")
-	c.Stepping = int32(stepping)
-	features, err := unix.Sysctl("machdep.cpu.features")
-	if err == nil {
-		for _, v := range strings.Fields(features) {
-			c.Flags = append(c.Flags, strings.ToLower(v))
-		}
-	}
-	leaf7Features, err := unix.Sysctl("machdep.cpu.leaf7_features")
-	if err == nil {
-		for _, v := range strings.Fields(leaf7Features) {
-			c.Flags = append(c.Flags, strings.ToLower(v))
-		}
-	}
-	extfeatures, err := unix.Sysctl("machdep.cpu.extfeatures")
-	if err == nil {
-		for _, v := range strings.Fields(extfeatures) {
-			c.Flags = append(c.Flags, strings.ToLower(v))
-		}
-	}
-	cores, _ := unix.SysctlUint32("machdep.cpu.core_count")
-	c.Cores = int32(cores)
-	cacheSize, _ := unix.SysctlUint32("machdep.cpu.cache.size")
-	c.CacheSize = int32(cacheSize)
-	c.VendorID, _ = unix.Sysctl("machdep.cpu.vendor")
-
-	cpuFrequency := 3200000000
-	c.Mhz = float64(cpuFrequency) / 1000000.0
-
-	return append(ret, c), nil
-}
+// InfoWithContext returns the per-CPU information known to the host. Its
+// implementation is platform specific; see stats_<os>.go.
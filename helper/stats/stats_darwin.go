@@ -0,0 +1,110 @@
+//go:build darwin
+
+package stats
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"golang.org/x/sys/unix"
+)
+
+func InfoWithContext(ctx context.Context) ([]InfoStat, error) {
+	var ret []InfoStat
+
+	c := InfoStat{}
+	c.ModelName, _ = unix.Sysctl("machdep.cpu.brand_string")
+	family, _ := unix.SysctlUint32("machdep.cpu.family")
+	c.Family = strconv.FormatUint(uint64(family), 10)
+	model, _ := unix.SysctlUint32("machdep.cpu.model")
+	c.Model = strconv.FormatUint(uint64(model), 10)
+	stepping, _ := unix.SysctlUint32("machdep.cpu.stepping")
+	c.Stepping = int32(stepping)
+	features, err := unix.Sysctl("machdep.cpu.features")
+	if err == nil {
+		for _, v := range strings.Fields(features) {
+			c.Flags = append(c.Flags, strings.ToLower(v))
+		}
+	}
+	leaf7Features, err := unix.Sysctl("machdep.cpu.leaf7_features")
+	if err == nil {
+		for _, v := range strings.Fields(leaf7Features) {
+			c.Flags = append(c.Flags, strings.ToLower(v))
+		}
+	}
+	extfeatures, err := unix.Sysctl("machdep.cpu.extfeatures")
+	if err == nil {
+		for _, v := range strings.Fields(extfeatures) {
+			c.Flags = append(c.Flags, strings.ToLower(v))
+		}
+	}
+	cores, _ := unix.SysctlUint32("machdep.cpu.core_count")
+	c.Cores = int32(cores)
+	cacheSize, _ := unix.SysctlUint32("machdep.cpu.cache.size")
+	c.CacheSize = int32(cacheSize)
+	c.VendorID, _ = unix.Sysctl("machdep.cpu.vendor")
+
+	// hw.cpufrequency* are deprecated on Apple Silicon, so fall back to a
+	// conservative default when the sysctls aren't available.
+	if freq, err := unix.SysctlUint64("hw.cpufrequency"); err == nil {
+		c.Mhz.Current = float64(freq) / 1000000.0
+	} else {
+		c.Mhz.Current = 3200
+	}
+	if freq, err := unix.SysctlUint64("hw.cpufrequency_min"); err == nil {
+		c.Mhz.Min = float64(freq) / 1000000.0
+	} else {
+		c.Mhz.Min = c.Mhz.Current
+	}
+	if freq, err := unix.SysctlUint64("hw.cpufrequency_max"); err == nil {
+		c.Mhz.Max = float64(freq) / 1000000.0
+	} else {
+		c.Mhz.Max = c.Mhz.Current
+	}
+
+	return append(ret, c), nil
+}
+
+// TimesWithContext reports CPU tick counts. Darwin has no kern.cp_time-style
+// sysctl (that's a *BSD-only interface); the only way to get per-CPU ticks
+// is the Mach host_processor_info() call, which requires cgo. Rather than
+// reimplement that, delegate to the already-vendored gopsutil, whose cgo
+// Darwin build handles it.
+func TimesWithContext(ctx context.Context, percpu bool) ([]TimesStat, error) {
+	times, err := cpu.TimesWithContext(ctx, percpu)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]TimesStat, 0, len(times))
+	for _, t := range times {
+		ret = append(ret, TimesStat{
+			CPU:       t.CPU,
+			User:      t.User,
+			System:    t.System,
+			Idle:      t.Idle,
+			Nice:      t.Nice,
+			Iowait:    t.Iowait,
+			Irq:       t.Irq,
+			Softirq:   t.Softirq,
+			Steal:     t.Steal,
+			Guest:     t.Guest,
+			GuestNice: t.GuestNice,
+		})
+	}
+	return ret, nil
+}
+
+// effectiveCPUCount returns host unmodified; cgroup-style CPU quotas are a
+// Linux-only concept.
+func effectiveCPUCount(host int) int {
+	return host
+}
+
+// effectiveCoreFraction returns host unmodified; cgroup-style CPU quotas are
+// a Linux-only concept.
+func effectiveCoreFraction(host int) float64 {
+	return float64(host)
+}
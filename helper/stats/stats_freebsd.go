@@ -0,0 +1,124 @@
+//go:build freebsd
+
+package stats
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// cpStates is the number of CPU time states reported by the kern.cp_time and
+// kern.cp_times sysctls: user, nice, system, interrupt, idle.
+const cpStates = 5
+
+func InfoWithContext(ctx context.Context) ([]InfoStat, error) {
+	var ret []InfoStat
+
+	c := InfoStat{}
+	c.ModelName, _ = unix.Sysctl("hw.model")
+	if clockRate, err := unix.SysctlUint32("hw.clockrate"); err == nil {
+		c.Mhz.Current = float64(clockRate)
+	}
+	if ncpu, err := unix.SysctlUint32("hw.ncpu"); err == nil {
+		c.Cores = int32(ncpu)
+	}
+	if fields := strings.Fields(c.ModelName); len(fields) > 0 {
+		c.VendorID = fields[0]
+	}
+
+	// dev.cpu.0.freq_levels lists available P-states as "mhz/mw ...",
+	// highest first, when the cpufreq(4) driver is loaded.
+	if levels, err := unix.Sysctl("dev.cpu.0.freq_levels"); err == nil {
+		fields := strings.Fields(levels)
+		if len(fields) > 0 {
+			if mhz, err := strconv.ParseFloat(strings.SplitN(fields[0], "/", 2)[0], 64); err == nil {
+				c.Mhz.Max = mhz
+			}
+			if mhz, err := strconv.ParseFloat(strings.SplitN(fields[len(fields)-1], "/", 2)[0], 64); err == nil {
+				c.Mhz.Min = mhz
+			}
+		}
+	}
+	if c.Mhz.Max == 0 {
+		c.Mhz.Max = c.Mhz.Current
+	}
+	if c.Mhz.Min == 0 {
+		c.Mhz.Min = c.Mhz.Current
+	}
+
+	return append(ret, c), nil
+}
+
+// TimesWithContext reports CPU tick counts via the kern.cp_time (aggregate)
+// and kern.cp_times (per-CPU) sysctls.
+func TimesWithContext(ctx context.Context, percpu bool) ([]TimesStat, error) {
+	if percpu {
+		raw, err := unix.SysctlRaw("kern.cp_times")
+		if err != nil {
+			return nil, err
+		}
+		return parseCPTimes(raw)
+	}
+
+	raw, err := unix.SysctlRaw("kern.cp_time")
+	if err != nil {
+		return nil, err
+	}
+	t, err := parseCPTime(raw, 0)
+	if err != nil {
+		return nil, err
+	}
+	return []TimesStat{t}, nil
+}
+
+func parseCPTimes(raw []byte) ([]TimesStat, error) {
+	perCPU := cpStates * 8
+	ncpu := len(raw) / perCPU
+
+	ret := make([]TimesStat, 0, ncpu)
+	for i := 0; i < ncpu; i++ {
+		t, err := parseCPTime(raw[i*perCPU:(i+1)*perCPU], i)
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, t)
+	}
+	return ret, nil
+}
+
+func parseCPTime(raw []byte, cpuID int) (TimesStat, error) {
+	if len(raw) < cpStates*8 {
+		return TimesStat{}, fmt.Errorf("short cp_time sysctl result: got %d bytes, want %d", len(raw), cpStates*8)
+	}
+
+	vals := make([]float64, cpStates)
+	for i := 0; i < cpStates; i++ {
+		vals[i] = float64(binary.LittleEndian.Uint64(raw[i*8:])) / ClocksPerSec
+	}
+
+	return TimesStat{
+		CPU:    fmt.Sprintf("cpu%d", cpuID),
+		User:   vals[0],
+		Nice:   vals[1],
+		System: vals[2],
+		Irq:    vals[3],
+		Idle:   vals[4],
+	}, nil
+}
+
+// effectiveCPUCount returns host unmodified; cgroup-style CPU quotas are a
+// Linux-only concept.
+func effectiveCPUCount(host int) int {
+	return host
+}
+
+// effectiveCoreFraction returns host unmodified; cgroup-style CPU quotas are
+// a Linux-only concept.
+func effectiveCoreFraction(host int) float64 {
+	return float64(host)
+}
@@ -0,0 +1,442 @@
+//go:build linux
+
+package stats
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func InfoWithContext(ctx context.Context) ([]InfoStat, error) {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ret []InfoStat
+	c := InfoStat{}
+	started := false
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if started {
+				ret = append(ret, c)
+			}
+			c = InfoStat{}
+			started = false
+			continue
+		}
+
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(fields[0])
+		value := strings.TrimSpace(fields[1])
+
+		switch key {
+		case "processor":
+			started = true
+			v, _ := strconv.ParseInt(value, 10, 32)
+			c.CPU = int32(v)
+		case "vendor_id", "vendor":
+			c.VendorID = value
+		case "cpu family":
+			c.Family = value
+		case "model":
+			c.Model = value
+		case "model name":
+			c.ModelName = value
+		case "stepping":
+			v, _ := strconv.ParseInt(value, 10, 32)
+			c.Stepping = int32(v)
+		case "cpu cores":
+			v, _ := strconv.ParseInt(value, 10, 32)
+			c.Cores = int32(v)
+		case "physical id":
+			c.PhysicalID = value
+		case "core id":
+			c.CoreID = value
+		case "cache size":
+			v, _ := strconv.ParseInt(strings.TrimSuffix(value, " KB"), 10, 32)
+			c.CacheSize = int32(v)
+		case "flags", "Features":
+			c.Flags = strings.Fields(value)
+		case "microcode":
+			c.Microcode = value
+		case "cpu MHz":
+			v, _ := strconv.ParseFloat(value, 64)
+			c.Mhz.Current = v
+		}
+	}
+	if started {
+		ret = append(ret, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return ret, err
+	}
+
+	// /proc/cpuinfo's "cpu MHz" reflects the current, possibly scaled,
+	// frequency, so prefer the cpufreq driver's cpuinfo_{cur,min,max}_freq
+	// files when they're exposed.
+	for i := range ret {
+		cpuID := int(ret[i].CPU)
+		if cur, err := cpuFreqMhz(cpuID, "cpuinfo_cur_freq"); err == nil {
+			ret[i].Mhz.Current = cur
+		}
+		if min, err := cpuFreqMhz(cpuID, "cpuinfo_min_freq"); err == nil {
+			ret[i].Mhz.Min = min
+		}
+		if max, err := cpuFreqMhz(cpuID, "cpuinfo_max_freq"); err == nil {
+			ret[i].Mhz.Max = max
+		} else {
+			// No cpufreq driver; the current frequency is the best estimate
+			// of the max we have.
+			ret[i].Mhz.Max = ret[i].Mhz.Current
+		}
+	}
+
+	return ret, nil
+}
+
+// cpuFreqMhz reads one of the cpufreq driver's frequency files (e.g.
+// cpuinfo_max_freq), in MHz, for the given CPU. The files report kHz.
+func cpuFreqMhz(cpuID int, file string) (float64, error) {
+	path := fmt.Sprintf("/sys/devices/system/cpu/cpu%d/cpufreq/%s", cpuID, file)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	khz, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return 0, err
+	}
+	return khz / 1000.0, nil
+}
+
+func TimesWithContext(ctx context.Context, percpu bool) ([]TimesStat, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ret []TimesStat
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+
+		isAggregate := fields[0] == "cpu"
+		if isAggregate == percpu {
+			// Skip the aggregate line when percpu is requested, and skip the
+			// per-CPU lines when only the aggregate is requested.
+			continue
+		}
+
+		t, err := parseProcStatCPULine(fields)
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return ret, err
+	}
+
+	return ret, nil
+}
+
+// parseProcStatCPULine parses a "cpu" or "cpuN" line from /proc/stat. Older
+// kernels omit the trailing fields (steal, guest, guest_nice), which then
+// default to zero; any fields beyond guest_nice are ignored.
+func parseProcStatCPULine(fields []string) (TimesStat, error) {
+	t := TimesStat{CPU: fields[0]}
+
+	values := make([]float64, len(fields)-1)
+	for i, f := range fields[1:] {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return t, fmt.Errorf("unable to parse /proc/stat field %q: %w", f, err)
+		}
+		values[i] = v / ClocksPerSec
+	}
+
+	for i, v := range values {
+		switch i {
+		case 0:
+			t.User = v
+		case 1:
+			t.Nice = v
+		case 2:
+			t.System = v
+		case 3:
+			t.Idle = v
+		case 4:
+			t.Iowait = v
+		case 5:
+			t.Irq = v
+		case 6:
+			t.Softirq = v
+		case 7:
+			t.Steal = v
+		case 8:
+			t.Guest = v
+		case 9:
+			t.GuestNice = v
+		}
+	}
+
+	return t, nil
+}
+
+// effectiveCPUCount clamps host to the CFS quota (cgroup v1 or v2) and
+// cpuset.cpus.effective in effect for this process, if any.
+func effectiveCPUCount(host int) int {
+	n := host
+
+	if quotaCores, ok := cgroupV2QuotaCores(); ok {
+		n = minInt(n, quotaCores)
+	} else if quotaCores, ok := cgroupV1QuotaCores(); ok {
+		n = minInt(n, quotaCores)
+	}
+
+	if cpusetCores, ok := cgroupCpusetCores(); ok {
+		n = minInt(n, cpusetCores)
+	}
+
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// effectiveCoreFraction is like effectiveCPUCount, but reports the raw,
+// unrounded core budget implied by the CFS quota and cpuset instead of a
+// whole-core count. Tick-budget math should use this rather than
+// effectiveCPUCount, since rounding a fractional quota up to a whole core
+// overstates the budget the cgroup actually guarantees.
+func effectiveCoreFraction(host int) float64 {
+	n := float64(host)
+
+	if frac, ok := cgroupQuotaFraction(); ok {
+		n = math.Min(n, frac)
+	}
+
+	if cpusetCores, ok := cgroupCpusetCores(); ok {
+		n = math.Min(n, float64(cpusetCores))
+	}
+
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
+
+// cgroupQuotaFraction returns the unrounded core count implied by the CFS
+// quota (cgroup v2's cpu.max, falling back to v1's cfs_quota_us/
+// cfs_period_us), if a quota is set.
+func cgroupQuotaFraction() (float64, bool) {
+	if quota, period, ok := cgroupV2Quota(); ok {
+		return quota / period, true
+	}
+	if quota, period, ok := cgroupV1Quota(); ok {
+		return quota / period, true
+	}
+	return 0, false
+}
+
+// selfCgroupPath returns this process's path within the given cgroup v1
+// controller (e.g. "cpu", "cpuset"), or within the unified v2 hierarchy when
+// controller is "". It parses /proc/self/cgroup so that nested scopes, like
+// the systemd-managed "/system.slice/nomad.service" Nomad typically runs
+// under, are honored instead of assuming the process sits at the cgroup
+// root.
+func selfCgroupPath(controller string) (string, bool) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", false
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		subsystems, path := fields[1], fields[2]
+
+		if controller == "" {
+			if subsystems == "" { // cgroup v2: "0::/path"
+				return path, true
+			}
+			continue
+		}
+		for _, s := range strings.Split(subsystems, ",") {
+			if s == controller {
+				return path, true
+			}
+		}
+	}
+	return "", false
+}
+
+// cgroupV2File resolves a file under this process's unified (v2) cgroup
+// directory, falling back to the mount root if /proc/self/cgroup can't be
+// read.
+func cgroupV2File(name string) string {
+	if path, ok := selfCgroupPath(""); ok {
+		return filepath.Join("/sys/fs/cgroup", path, name)
+	}
+	return filepath.Join("/sys/fs/cgroup", name)
+}
+
+// cgroupV1File resolves a file under this process's cgroup v1 directory for
+// the given controller, falling back to the controller's mount root if
+// /proc/self/cgroup can't be read.
+func cgroupV1File(controller, name string) string {
+	if path, ok := selfCgroupPath(controller); ok {
+		return filepath.Join("/sys/fs/cgroup", controller, path, name)
+	}
+	return filepath.Join("/sys/fs/cgroup", controller, name)
+}
+
+// cgroupV2QuotaCores reads the unified cgroup hierarchy's cpu.max, which
+// holds "$MAX $PERIOD" in microseconds, or "max $PERIOD" when unconstrained.
+func cgroupV2QuotaCores() (int, bool) {
+	quota, period, ok := cgroupV2Quota()
+	if !ok {
+		return 0, false
+	}
+	return coresFromQuota(quota, period), true
+}
+
+// cgroupV1QuotaCores reads the cpu controller's cfs_quota_us/cfs_period_us,
+// which are -1 and unset respectively when unconstrained.
+func cgroupV1QuotaCores() (int, bool) {
+	quota, period, ok := cgroupV1Quota()
+	if !ok {
+		return 0, false
+	}
+	return coresFromQuota(quota, period), true
+}
+
+func cgroupV2Quota() (quota, period float64, ok bool) {
+	data, err := os.ReadFile(cgroupV2File("cpu.max"))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, 0, false
+	}
+
+	quota, err = strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	period, err = strconv.ParseFloat(fields[1], 64)
+	if err != nil || period <= 0 {
+		return 0, 0, false
+	}
+	return quota, period, true
+}
+
+func cgroupV1Quota() (quota, period float64, ok bool) {
+	q, err := readCgroupInt(cgroupV1File("cpu", "cpu.cfs_quota_us"))
+	if err != nil || q <= 0 {
+		return 0, 0, false
+	}
+	p, err := readCgroupInt(cgroupV1File("cpu", "cpu.cfs_period_us"))
+	if err != nil || p <= 0 {
+		return 0, 0, false
+	}
+	return float64(q), float64(p), true
+}
+
+// coresFromQuota floors the quota/period ratio to a whole core count. It
+// floors, rather than rounds, so that a fractional quota never reports more
+// cores than the cgroup actually guarantees; callers that need the
+// unrounded ratio (e.g. tick-budget math) should use the quota and period
+// directly instead.
+func coresFromQuota(quota, period float64) int {
+	cores := int(math.Floor(quota / period))
+	if cores < 1 {
+		cores = 1
+	}
+	return cores
+}
+
+func readCgroupInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// cgroupCpusetCores returns the number of CPUs in the cpuset this process is
+// confined to, checking the cgroup v2 and then the cgroup v1 location.
+func cgroupCpusetCores() (int, bool) {
+	for _, path := range []string{
+		cgroupV2File("cpuset.cpus.effective"),
+		cgroupV1File("cpuset", "cpuset.effective_cpus"),
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if n, err := countCPUList(strings.TrimSpace(string(data))); err == nil && n > 0 {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// countCPUList counts the CPUs described by a cpuset list like "0-3,8,10-11".
+func countCPUList(list string) (int, error) {
+	if list == "" {
+		return 0, nil
+	}
+
+	count := 0
+	for _, part := range strings.Split(list, ",") {
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		loN, err := strconv.Atoi(lo)
+		if err != nil {
+			return 0, err
+		}
+		if !isRange {
+			count++
+			continue
+		}
+		hiN, err := strconv.Atoi(hi)
+		if err != nil {
+			return 0, err
+		}
+		count += hiN - loN + 1
+	}
+	return count, nil
+}
+
+func minInt(a, b int) int {
+	if b < a {
+		return b
+	}
+	return a
+}
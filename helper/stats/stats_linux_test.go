@@ -0,0 +1,92 @@
+//go:build linux
+
+package stats
+
+import "testing"
+
+func TestParseProcStatCPULine(t *testing.T) {
+	defer func(prev float64) { ClocksPerSec = prev }(ClocksPerSec)
+	ClocksPerSec = 100
+
+	fields := []string{"cpu0", "100", "10", "200", "300", "5", "1", "2", "0", "0", "0"}
+	got, err := parseProcStatCPULine(fields)
+	if err != nil {
+		t.Fatalf("parseProcStatCPULine(%v) returned error: %v", fields, err)
+	}
+
+	want := TimesStat{
+		CPU:     "cpu0",
+		User:    1,
+		Nice:    0.1,
+		System:  2,
+		Idle:    3,
+		Iowait:  0.05,
+		Irq:     0.01,
+		Softirq: 0.02,
+	}
+	if got != want {
+		t.Errorf("parseProcStatCPULine(%v) = %+v, want %+v", fields, got, want)
+	}
+}
+
+func TestParseProcStatCPULineInvalid(t *testing.T) {
+	fields := []string{"cpu0", "notanumber"}
+	if _, err := parseProcStatCPULine(fields); err == nil {
+		t.Errorf("parseProcStatCPULine(%v) expected an error, got nil", fields)
+	}
+}
+
+func TestCountCPUList(t *testing.T) {
+	cases := []struct {
+		list    string
+		want    int
+		wantErr bool
+	}{
+		{list: "", want: 0},
+		{list: "0", want: 1},
+		{list: "0-3", want: 4},
+		{list: "0-3,8", want: 5},
+		{list: "0,2,4-7,9", want: 7},
+		{list: "not-a-range-x", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.list, func(t *testing.T) {
+			got, err := countCPUList(tc.list)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("countCPUList(%q) expected an error, got nil", tc.list)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("countCPUList(%q) returned error: %v", tc.list, err)
+			}
+			if got != tc.want {
+				t.Errorf("countCPUList(%q) = %d, want %d", tc.list, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCoresFromQuota(t *testing.T) {
+	cases := []struct {
+		name   string
+		quota  float64
+		period float64
+		want   int
+	}{
+		{name: "one full core", quota: 100000, period: 100000, want: 1},
+		{name: "two and a half cores floors to two", quota: 250000, period: 100000, want: 2},
+		{name: "quarter core floors to one", quota: 25000, period: 100000, want: 1},
+		{name: "zero quota floors to one", quota: 0, period: 100000, want: 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := coresFromQuota(tc.quota, tc.period); got != tc.want {
+				t.Errorf("coresFromQuota(%v, %v) = %d, want %d", tc.quota, tc.period, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+//go:build windows
+
+package stats
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const systemProcessorPerformanceInformationClass = 8
+
+// systemProcessorPerformanceInformation mirrors the
+// SYSTEM_PROCESSOR_PERFORMANCE_INFORMATION struct returned by
+// NtQuerySystemInformation, one per logical CPU. All times are in 100ns
+// units.
+type systemProcessorPerformanceInformation struct {
+	IdleTime       int64
+	KernelTime     int64
+	UserTime       int64
+	DpcTime        int64
+	InterruptTime  int64
+	InterruptCount uint32
+	_              uint32 // padding
+}
+
+// win32SystemInfo mirrors the fields of SYSTEM_INFO that we need. x/sys/windows
+// doesn't wrap GetSystemInfo, so the struct and proc are declared directly
+// here, same as gopsutil does for the Windows-specific syscalls it needs.
+type win32SystemInfo struct {
+	wProcessorArchitecture      uint16
+	wReserved                   uint16
+	dwPageSize                  uint32
+	lpMinimumApplicationAddress uintptr
+	lpMaximumApplicationAddress uintptr
+	dwActiveProcessorMask       uintptr
+	dwNumberOfProcessors        uint32
+	dwProcessorType             uint32
+	dwAllocationGranularity     uint32
+	wProcessorLevel             uint16
+	wProcessorRevision          uint16
+}
+
+// processorInformation is the ProcessorInformation member of the
+// POWER_INFORMATION_LEVEL enum, used with CallNtPowerInformation to fetch
+// live per-core clock speed.
+const processorInformation = 11
+
+// win32ProcessorPowerInformation mirrors PROCESSOR_POWER_INFORMATION, one per
+// logical CPU.
+type win32ProcessorPowerInformation struct {
+	Number           uint32
+	MaxMhz           uint32
+	CurrentMhz       uint32
+	MhzLimit         uint32
+	MaxIdleState     uint32
+	CurrentIdleState uint32
+}
+
+var (
+	modntdll    = windows.NewLazySystemDLL("ntdll.dll")
+	modkernel32 = windows.NewLazySystemDLL("kernel32.dll")
+	modpowrprof = windows.NewLazySystemDLL("powrprof.dll")
+
+	procNtQuerySystemInformation = modntdll.NewProc("NtQuerySystemInformation")
+	procGetSystemTimes           = modkernel32.NewProc("GetSystemTimes")
+	procGetSystemInfo            = modkernel32.NewProc("GetSystemInfo")
+	procCallNtPowerInformation   = modpowrprof.NewProc("CallNtPowerInformation")
+)
+
+// numLogicalProcessors returns the number of logical CPUs reported by
+// GetSystemInfo.
+func numLogicalProcessors() int {
+	var sysInfo win32SystemInfo
+	procGetSystemInfo.Call(uintptr(unsafe.Pointer(&sysInfo)))
+	return int(sysInfo.dwNumberOfProcessors)
+}
+
+// processorPowerInfo returns the live clock speed for every logical CPU via
+// CallNtPowerInformation(ProcessorInformation), the same API powercfg and
+// Task Manager use to report current/max MHz.
+func processorPowerInfo(ncpu int) ([]win32ProcessorPowerInformation, error) {
+	buf := make([]win32ProcessorPowerInformation, ncpu)
+	size := uintptr(ncpu) * unsafe.Sizeof(win32ProcessorPowerInformation{})
+
+	status, _, _ := procCallNtPowerInformation.Call(
+		uintptr(processorInformation),
+		0,
+		0,
+		uintptr(unsafe.Pointer(&buf[0])),
+		size,
+	)
+	if status != 0 {
+		return nil, fmt.Errorf("CallNtPowerInformation failed with status 0x%x", status)
+	}
+	return buf, nil
+}
+
+func InfoWithContext(ctx context.Context) ([]InfoStat, error) {
+	var ret []InfoStat
+
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `HARDWARE\DESCRIPTION\System\CentralProcessor\0`, registry.QUERY_VALUE)
+	if err != nil {
+		return ret, err
+	}
+	defer key.Close()
+
+	c := InfoStat{CPU: 0, Cores: 1}
+
+	if vendorID, _, err := key.GetStringValue("VendorIdentifier"); err == nil {
+		c.VendorID = vendorID
+	}
+	if modelName, _, err := key.GetStringValue("ProcessorNameString"); err == nil {
+		c.ModelName = modelName
+	}
+	if identifier, _, err := key.GetStringValue("Identifier"); err == nil {
+		// Identifier looks like "Intel64 Family 6 Model 142 Stepping 10".
+		fields := strings.Fields(identifier)
+		for i, field := range fields {
+			if i+1 >= len(fields) {
+				break
+			}
+			switch field {
+			case "Family":
+				c.Family = fields[i+1]
+			case "Model":
+				c.Model = fields[i+1]
+			case "Stepping":
+				if v, err := strconv.ParseInt(fields[i+1], 10, 32); err == nil {
+					c.Stepping = int32(v)
+				}
+			}
+		}
+	}
+	// The registry's ~MHz is the nominal speed read at boot; fall back to it
+	// if the live power-information query below fails.
+	if mhz, _, err := key.GetIntegerValue("~MHz"); err == nil {
+		c.Mhz.Current = float64(mhz)
+		c.Mhz.Min = float64(mhz)
+		c.Mhz.Max = float64(mhz)
+	}
+
+	// CallNtPowerInformation(ProcessorInformation) reports the live clock
+	// speed, same as Task Manager and powercfg. MhzLimit reflects any policy
+	// throttle (e.g. battery saver), which is the closest analogue to
+	// cpuinfo_min_freq on this platform.
+	if power, err := processorPowerInfo(numLogicalProcessors()); err == nil && len(power) > 0 {
+		c.Mhz.Current = float64(power[0].CurrentMhz)
+		c.Mhz.Max = float64(power[0].MaxMhz)
+		c.Mhz.Min = float64(power[0].MhzLimit)
+	}
+
+	ret = append(ret, c)
+	return ret, nil
+}
+
+// TimesWithContext reports CPU tick counts. The aggregate case uses
+// GetSystemTimes; per-CPU counts require the undocumented but long-stable
+// NtQuerySystemInformation(SystemProcessorPerformanceInformation) call, same
+// as gopsutil and most other Windows process monitors.
+func TimesWithContext(ctx context.Context, percpu bool) ([]TimesStat, error) {
+	if !percpu {
+		var idle, kernel, user windows.Filetime
+		ret, _, err := procGetSystemTimes.Call(
+			uintptr(unsafe.Pointer(&idle)),
+			uintptr(unsafe.Pointer(&kernel)),
+			uintptr(unsafe.Pointer(&user)),
+		)
+		if ret == 0 {
+			return nil, fmt.Errorf("GetSystemTimes failed: %w", err)
+		}
+		idleTicks := filetimeTo100ns(idle)
+		kernelTicks := filetimeTo100ns(kernel)
+		userTicks := filetimeTo100ns(user)
+
+		return []TimesStat{{
+			CPU: "cpu-total",
+			// kernelTicks includes idle time on Windows.
+			System: hundredNsToSeconds(kernelTicks - idleTicks),
+			User:   hundredNsToSeconds(userTicks),
+			Idle:   hundredNsToSeconds(idleTicks),
+		}}, nil
+	}
+
+	ncpu := numLogicalProcessors()
+
+	buf := make([]systemProcessorPerformanceInformation, ncpu)
+	size := uintptr(ncpu) * unsafe.Sizeof(systemProcessorPerformanceInformation{})
+	var retLen uint32
+
+	status, _, _ := procNtQuerySystemInformation.Call(
+		uintptr(systemProcessorPerformanceInformationClass),
+		uintptr(unsafe.Pointer(&buf[0])),
+		size,
+		uintptr(unsafe.Pointer(&retLen)),
+	)
+	if status != 0 {
+		return nil, fmt.Errorf("NtQuerySystemInformation failed with status 0x%x", status)
+	}
+
+	ret := make([]TimesStat, 0, ncpu)
+	for i, p := range buf {
+		ret = append(ret, TimesStat{
+			CPU:    fmt.Sprintf("cpu%d", i),
+			User:   hundredNsToSeconds(p.UserTime),
+			System: hundredNsToSeconds(p.KernelTime - p.IdleTime),
+			Idle:   hundredNsToSeconds(p.IdleTime),
+			Irq:    hundredNsToSeconds(p.InterruptTime),
+		})
+	}
+	return ret, nil
+}
+
+func filetimeTo100ns(ft windows.Filetime) int64 {
+	return int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime)
+}
+
+func hundredNsToSeconds(v int64) float64 {
+	return float64(v) / 1e7
+}
+
+// effectiveCPUCount returns host unmodified; cgroup-style CPU quotas are a
+// Linux-only concept.
+func effectiveCPUCount(host int) int {
+	return host
+}
+
+// effectiveCoreFraction returns host unmodified; cgroup-style CPU quotas are
+// a Linux-only concept.
+func effectiveCoreFraction(host int) float64 {
+	return float64(host)
+}
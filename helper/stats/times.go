@@ -0,0 +1,178 @@
+package stats
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ClocksPerSec is the number of ticks per second used to convert raw tick
+// counts read from the kernel (e.g. /proc/stat) into seconds. It defaults to
+// the common USER_HZ value of 100 and is refined via sysconf(_SC_CLK_TCK) on
+// unix platforms; see clocks_unix.go.
+var ClocksPerSec = float64(100)
+
+// TimesStat holds the amount of time, in seconds, a CPU has spent in each
+// state since boot.
+type TimesStat struct {
+	CPU       string  `json:"cpu"`
+	User      float64 `json:"user"`
+	System    float64 `json:"system"`
+	Idle      float64 `json:"idle"`
+	Nice      float64 `json:"nice"`
+	Iowait    float64 `json:"iowait"`
+	Irq       float64 `json:"irq"`
+	Softirq   float64 `json:"softirq"`
+	Steal     float64 `json:"steal"`
+	Guest     float64 `json:"guest"`
+	GuestNice float64 `json:"guestNice"`
+}
+
+// Total returns the sum of all of the time spent in every state.
+func (t TimesStat) Total() float64 {
+	return t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq +
+		t.Softirq + t.Steal + t.Guest + t.GuestNice
+}
+
+func (t TimesStat) busy() float64 {
+	return t.Total() - t.Idle - t.Iowait
+}
+
+// Times returns the CPU time statistics known to the host. When percpu is
+// true, one TimesStat is returned per logical CPU; otherwise a single
+// aggregate TimesStat is returned. Its implementation is platform specific;
+// see stats_<os>.go.
+func Times(percpu bool) ([]TimesStat, error) {
+	return TimesWithContext(context.Background(), percpu)
+}
+
+// Tracker samples CPU time statistics at a fixed interval and exposes the
+// utilization, as a percentage, observed between the two most recent
+// samples.
+type Tracker struct {
+	mu      sync.RWMutex
+	prev    []TimesStat
+	percent float64
+	perCPU  []float64
+	cancel  context.CancelFunc
+}
+
+// NewTracker creates a Tracker with no samples taken yet. Call
+// StartAutoRefresh to begin sampling, or call Sample directly to take
+// samples on demand.
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// Sample takes a single CPU time sample and updates the utilization
+// percentages based on the delta since the previous sample. The first call
+// to Sample only establishes a baseline and reports zero utilization.
+func (t *Tracker) Sample() error {
+	cur, err := Times(true)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.prev) == len(cur) {
+		t.perCPU = make([]float64, len(cur))
+		for i := range cur {
+			t.perCPU[i] = percentBusy(t.prev[i], cur[i])
+		}
+
+		prevAgg, curAgg := aggregate(t.prev), aggregate(cur)
+		t.percent = percentBusy(prevAgg, curAgg)
+	}
+
+	t.prev = cur
+	return nil
+}
+
+// StartAutoRefresh begins a background goroutine that calls Sample on the
+// given interval until Stop is called. It replaces any auto-refresh
+// goroutine previously started on this Tracker.
+func (t *Tracker) StartAutoRefresh(interval time.Duration) {
+	t.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.mu.Lock()
+	t.cancel = cancel
+	t.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = t.Sample()
+			}
+		}
+	}()
+}
+
+// Stop halts the background sampling goroutine started by StartAutoRefresh,
+// if any.
+func (t *Tracker) Stop() {
+	t.mu.Lock()
+	cancel := t.cancel
+	t.cancel = nil
+	t.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// CPUPercent returns the aggregate CPU utilization, as a percentage,
+// observed between the two most recent samples.
+func (t *Tracker) CPUPercent() float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.percent
+}
+
+// PerCPUPercent returns the per-core CPU utilization, as a percentage,
+// observed between the two most recent samples.
+func (t *Tracker) PerCPUPercent() []float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make([]float64, len(t.perCPU))
+	copy(out, t.perCPU)
+	return out
+}
+
+func aggregate(stats []TimesStat) TimesStat {
+	var agg TimesStat
+	for _, s := range stats {
+		agg.User += s.User
+		agg.System += s.System
+		agg.Idle += s.Idle
+		agg.Nice += s.Nice
+		agg.Iowait += s.Iowait
+		agg.Irq += s.Irq
+		agg.Softirq += s.Softirq
+		agg.Steal += s.Steal
+		agg.Guest += s.Guest
+		agg.GuestNice += s.GuestNice
+	}
+	return agg
+}
+
+// percentBusy returns the percentage of time between prev and cur that was
+// spent in a non-idle state.
+func percentBusy(prev, cur TimesStat) float64 {
+	totalDelta := cur.Total() - prev.Total()
+	if totalDelta <= 0 {
+		return 0
+	}
+	busyDelta := cur.busy() - prev.busy()
+	if busyDelta < 0 {
+		busyDelta = 0
+	}
+	return (busyDelta / totalDelta) * 100
+}
@@ -0,0 +1,70 @@
+package stats
+
+import "testing"
+
+func TestPercentBusy(t *testing.T) {
+	cases := []struct {
+		name string
+		prev TimesStat
+		cur  TimesStat
+		want float64
+	}{
+		{
+			name: "fully idle",
+			prev: TimesStat{Idle: 100},
+			cur:  TimesStat{Idle: 200},
+			want: 0,
+		},
+		{
+			name: "fully busy",
+			prev: TimesStat{User: 100},
+			cur:  TimesStat{User: 200},
+			want: 100,
+		},
+		{
+			name: "half busy half idle",
+			prev: TimesStat{User: 0, Idle: 0},
+			cur:  TimesStat{User: 50, Idle: 50},
+			want: 50,
+		},
+		{
+			name: "iowait does not count as busy",
+			prev: TimesStat{Iowait: 0},
+			cur:  TimesStat{Iowait: 100},
+			want: 0,
+		},
+		{
+			name: "no elapsed time",
+			prev: TimesStat{User: 100},
+			cur:  TimesStat{User: 100},
+			want: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := percentBusy(tc.prev, tc.cur); got != tc.want {
+				t.Errorf("percentBusy(%+v, %+v) = %v, want %v", tc.prev, tc.cur, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	stats := []TimesStat{
+		{User: 1, System: 2, Idle: 3},
+		{User: 4, System: 5, Idle: 6},
+	}
+
+	got := aggregate(stats)
+	want := TimesStat{User: 5, System: 7, Idle: 9}
+	if got != want {
+		t.Errorf("aggregate(%+v) = %+v, want %+v", stats, got, want)
+	}
+}
+
+func TestAggregateEmpty(t *testing.T) {
+	if got := aggregate(nil); got != (TimesStat{}) {
+		t.Errorf("aggregate(nil) = %+v, want zero value", got)
+	}
+}